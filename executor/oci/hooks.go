@@ -0,0 +1,330 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/util/bklog"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// hookStage names a point in the OCI runtime hook lifecycle a HookDescriptor
+// can be attached to. "precreate" is BuildKit-specific: unlike the others it
+// doesn't become a runtime-spec hook that runc fires, it runs synchronously
+// during spec assembly and is allowed to rewrite the spec itself.
+type hookStage string
+
+const (
+	stagePreCreate       hookStage = "precreate"
+	stagePreStart        hookStage = "prestart"
+	stageCreateRuntime   hookStage = "createRuntime"
+	stageCreateContainer hookStage = "createContainer"
+	stageStartContainer  hookStage = "startContainer"
+	stagePostStart       hookStage = "poststart"
+	stagePostStop        hookStage = "poststop"
+)
+
+// HookDescriptor is the on-disk JSON shape of a hook registered in a
+// HookManager's directory, modeled on the OCI hooks.d convention used by
+// podman/CRI-O so existing operator tooling can be reused as-is.
+type HookDescriptor struct {
+	Version string `json:"version"`
+	Hook    struct {
+		Path    string   `json:"path"`
+		Args    []string `json:"args,omitempty"`
+		Env     []string `json:"env,omitempty"`
+		Timeout *int     `json:"timeout,omitempty"`
+	} `json:"hook"`
+	When struct {
+		Always        bool              `json:"always,omitempty"`
+		Annotations   map[string]string `json:"annotations,omitempty"`
+		Commands      []string          `json:"commands,omitempty"`
+		HasBindMounts bool              `json:"hasBindMounts,omitempty"`
+	} `json:"when"`
+	Stages []hookStage `json:"stages"`
+}
+
+// HookManager evaluates a directory of HookDescriptors against an
+// in-progress spec. Hooks whose "when" clause matches either get appended
+// as runtime-spec lifecycle hooks (for stages runc fires directly) or, for
+// the "precreate" stage, run immediately with the current spec piped to
+// their stdin and their stdout substituted back in as the new spec.
+type HookManager struct {
+	dir   string
+	hooks []HookDescriptor
+}
+
+// NewHookManager loads every *.json descriptor in dir. A missing dir is not
+// an error: it just means no hooks are configured, matching how the rest of
+// the executor treats optional configuration directories.
+func NewHookManager(dir string) (*HookManager, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read hooks directory %s", dir)
+	}
+
+	hm := &HookManager{dir: dir}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		dt, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read hook descriptor %s", path)
+		}
+		var hd HookDescriptor
+		if err := json.Unmarshal(dt, &hd); err != nil {
+			return nil, errors.Wrapf(err, "invalid hook descriptor %s", path)
+		}
+		if hd.Hook.Path == "" {
+			return nil, errors.Errorf("hook descriptor %s: hook.path is required", path)
+		}
+		hm.hooks = append(hm.hooks, hd)
+	}
+	return hm, nil
+}
+
+// loadHookManager returns NewHookManager(dir) unchanged. The *HookManager it
+// returns may be nil (empty or missing dir); callers need not special-case
+// that because Apply treats a nil receiver as having no hooks.
+func loadHookManager(dir string) (*HookManager, error) {
+	return NewHookManager(dir)
+}
+
+// Apply evaluates every registered hook against s and mutates it in place:
+// lifecycle-stage hooks are appended to s.Hooks, and any "precreate" hook
+// whose "when" clause matches is run synchronously with s piped to its
+// stdin, replacing s with the JSON it writes to stdout.
+func (hm *HookManager) Apply(ctx context.Context, s *specs.Spec, annotations map[string]string) error {
+	if hm == nil {
+		return nil
+	}
+	for _, hd := range hm.hooks {
+		if !hm.matches(hd, s, annotations) {
+			continue
+		}
+		for _, stage := range hd.Stages {
+			if stage == stagePreCreate {
+				if err := runPreCreateFilter(ctx, hd, s); err != nil {
+					return errors.Wrapf(err, "precreate hook %s", hd.Hook.Path)
+				}
+				continue
+			}
+			appendLifecycleHook(s, stage, hd)
+		}
+	}
+	return nil
+}
+
+// matches reports whether every condition hd.When sets is satisfied; an
+// unset condition imposes no constraint, but any condition that is set must
+// hold for the descriptor to fire. A descriptor with no conditions set (and
+// "always" false) never matches.
+func (hm *HookManager) matches(hd HookDescriptor, s *specs.Spec, annotations map[string]string) bool {
+	if hd.When.Always {
+		return true
+	}
+
+	constrained := false
+
+	if hd.When.HasBindMounts {
+		constrained = true
+		hasBind := false
+		for _, m := range s.Mounts {
+			if m.Type == "bind" {
+				hasBind = true
+				break
+			}
+		}
+		if !hasBind {
+			return false
+		}
+	}
+
+	if len(hd.When.Annotations) > 0 {
+		constrained = true
+		for k, v := range hd.When.Annotations {
+			if annotations[k] != v {
+				return false
+			}
+		}
+	}
+
+	if len(hd.When.Commands) > 0 {
+		constrained = true
+		if len(s.Process.Args) == 0 {
+			return false
+		}
+		matched := false
+		for _, c := range hd.When.Commands {
+			if c == s.Process.Args[0] {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return constrained
+}
+
+func appendLifecycleHook(s *specs.Spec, stage hookStage, hd HookDescriptor) {
+	h := specs.Hook{
+		Path: hd.Hook.Path,
+		Args: hd.Hook.Args,
+		Env:  hd.Hook.Env,
+	}
+	if hd.Hook.Timeout != nil {
+		h.Timeout = hd.Hook.Timeout
+	}
+	if s.Hooks == nil {
+		s.Hooks = &specs.Hooks{}
+	}
+	switch stage {
+	case stagePreStart: //nolint:staticcheck // deprecated in the spec, still fired by runc
+		s.Hooks.Prestart = append(s.Hooks.Prestart, h)
+	case stageCreateRuntime:
+		s.Hooks.CreateRuntime = append(s.Hooks.CreateRuntime, h)
+	case stageCreateContainer:
+		s.Hooks.CreateContainer = append(s.Hooks.CreateContainer, h)
+	case stageStartContainer:
+		s.Hooks.StartContainer = append(s.Hooks.StartContainer, h)
+	case stagePostStart:
+		s.Hooks.Poststart = append(s.Hooks.Poststart, h)
+	case stagePostStop:
+		s.Hooks.Poststop = append(s.Hooks.Poststop, h)
+	}
+}
+
+// runPreCreateFilter pipes the current spec as JSON to the hook's stdin and
+// replaces it with the spec read back from its stdout, so the hook acts as a
+// "runtime config filter" in the sense podman/CRI-O use the term. The
+// mounts/env/hooks CDI already injected must survive the round trip; a hook
+// that clobbers them is treated as a structured error rather than silently
+// accepted.
+func runPreCreateFilter(ctx context.Context, hd HookDescriptor, s *specs.Spec) error {
+	before, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal spec for hook")
+	}
+
+	timeout := 10 * time.Second
+	if hd.Hook.Timeout != nil {
+		timeout = time.Duration(*hd.Hook.Timeout) * time.Second
+	}
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(cctx, hd.Hook.Path, hd.Hook.Args...)
+	cmd.Env = append(os.Environ(), hd.Hook.Env...)
+	cmd.Stdin = bytes.NewReader(before)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if cctx.Err() == context.DeadlineExceeded {
+			return errors.Errorf("hook timed out after %s", timeout)
+		}
+		return errors.Wrapf(err, "hook exited with error: %s", stderr.String())
+	}
+
+	var after specs.Spec
+	if err := json.Unmarshal(stdout.Bytes(), &after); err != nil {
+		return errors.Wrap(err, "hook did not return a valid OCI spec on stdout")
+	}
+	if err := validateHookDidNotClobberInjectedState(s, &after); err != nil {
+		return err
+	}
+
+	bklog.G(ctx).Debugf("applied precreate hook %s", hd.Hook.Path)
+	*s = after
+	return nil
+}
+
+// validateHookDidNotClobberInjectedState guards against a misbehaving filter
+// silently dropping the CDI-injected mounts, env or hooks that
+// generateCDIOpts added earlier in spec assembly. It compares by identity,
+// not just count: a filter that drops every injected mount/env var/hook and
+// adds an equal or greater number of unrelated ones must still be caught.
+func validateHookDidNotClobberInjectedState(before, after *specs.Spec) error {
+	afterMounts := make(map[string]bool, len(after.Mounts))
+	for _, m := range after.Mounts {
+		afterMounts[m.Destination] = true
+	}
+	for _, m := range before.Mounts {
+		if !afterMounts[m.Destination] {
+			return errors.Errorf("hook dropped mount %s present before it ran", m.Destination)
+		}
+	}
+
+	if before.Process != nil {
+		afterEnv := make(map[string]bool)
+		if after.Process != nil {
+			for _, e := range after.Process.Env {
+				afterEnv[envKey(e)] = true
+			}
+		}
+		for _, e := range before.Process.Env {
+			if !afterEnv[envKey(e)] {
+				return errors.Errorf("hook dropped env var %s present before it ran", envKey(e))
+			}
+		}
+	}
+
+	if before.Hooks != nil {
+		if after.Hooks == nil {
+			return errors.New("hook dropped all runtime hooks present before it ran")
+		}
+		stages := []struct {
+			name          string
+			before, after []specs.Hook
+		}{
+			{"prestart", before.Hooks.Prestart, after.Hooks.Prestart}, //nolint:staticcheck // deprecated in the spec, still fired by runc
+			{"createRuntime", before.Hooks.CreateRuntime, after.Hooks.CreateRuntime},
+			{"createContainer", before.Hooks.CreateContainer, after.Hooks.CreateContainer},
+			{"startContainer", before.Hooks.StartContainer, after.Hooks.StartContainer},
+			{"poststart", before.Hooks.Poststart, after.Hooks.Poststart},
+			{"poststop", before.Hooks.Poststop, after.Hooks.Poststop},
+		}
+		for _, stage := range stages {
+			afterPaths := make(map[string]bool, len(stage.after))
+			for _, h := range stage.after {
+				afterPaths[h.Path] = true
+			}
+			for _, h := range stage.before {
+				if !afterPaths[h.Path] {
+					return errors.Errorf("hook dropped %s hook %s present before it ran", stage.name, h.Path)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// envKey returns the name portion of a "NAME=value" environment entry so
+// env vars can be compared by identity rather than requiring an exact
+// "NAME=value" match, since a filter may legitimately rewrite a value.
+func envKey(kv string) string {
+	if i := strings.IndexByte(kv, '='); i >= 0 {
+		return kv[:i]
+	}
+	return kv
+}
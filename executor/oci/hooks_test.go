@@ -0,0 +1,116 @@
+package oci
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func newCommandsAndAnnotationsDescriptor() HookDescriptor {
+	var hd HookDescriptor
+	hd.When.Annotations = map[string]string{"build.internal": "true"}
+	hd.When.Commands = []string{"/bin/sh"}
+	return hd
+}
+
+func TestHookManagerMatchesANDsConditions(t *testing.T) {
+	hm := &HookManager{}
+	hd := newCommandsAndAnnotationsDescriptor()
+
+	spec := &specs.Spec{Process: &specs.Process{Args: []string{"/bin/sh", "-c", "echo hi"}}}
+
+	// Neither condition satisfied.
+	if hm.matches(hd, spec, nil) {
+		t.Fatal("expected no match when neither annotation nor command condition holds")
+	}
+
+	onlyAnnotation := &specs.Spec{Process: &specs.Process{Args: []string{"/usr/bin/env"}}}
+	if hm.matches(hd, onlyAnnotation, map[string]string{"build.internal": "true"}) {
+		t.Fatal("expected no match when only the annotation condition holds")
+	}
+
+	onlyCommand := &specs.Spec{Process: &specs.Process{Args: []string{"/bin/sh"}}}
+	if hm.matches(hd, onlyCommand, nil) {
+		t.Fatal("expected no match when only the command condition holds")
+	}
+
+	if !hm.matches(hd, spec, map[string]string{"build.internal": "true"}) {
+		t.Fatal("expected a match when both the annotation and command conditions hold")
+	}
+}
+
+func TestHookManagerMatchesAlwaysShortCircuits(t *testing.T) {
+	hm := &HookManager{}
+	hd := HookDescriptor{}
+	hd.When.Always = true
+	hd.When.Commands = []string{"this-will-never-match"}
+
+	if !hm.matches(hd, &specs.Spec{Process: &specs.Process{}}, nil) {
+		t.Fatal("expected always=true to match regardless of other unmet conditions")
+	}
+}
+
+func TestHookManagerMatchesNoConditionsNeverFires(t *testing.T) {
+	hm := &HookManager{}
+	if hm.matches(HookDescriptor{}, &specs.Spec{Process: &specs.Process{}}, nil) {
+		t.Fatal("expected a descriptor with no conditions set to never match")
+	}
+}
+
+func TestValidateHookDidNotClobberInjectedStateCatchesSwap(t *testing.T) {
+	before := &specs.Spec{
+		Mounts: []specs.Mount{{Destination: "/dev/injected"}},
+		Process: &specs.Process{
+			Env: []string{"CDI_VAR=1"},
+		},
+		Hooks: &specs.Hooks{
+			Prestart: []specs.Hook{{Path: "/sbin/cdi-prestart"}},
+		},
+	}
+
+	// A filter that drops the CDI-injected mount/env/hook but adds an equal
+	// number of unrelated ones must still be flagged; count-only comparison
+	// would let this through.
+	after := &specs.Spec{
+		Mounts: []specs.Mount{{Destination: "/dev/unrelated"}},
+		Process: &specs.Process{
+			Env: []string{"UNRELATED_VAR=1"},
+		},
+		Hooks: &specs.Hooks{
+			Prestart: []specs.Hook{{Path: "/sbin/unrelated"}},
+		},
+	}
+
+	if err := validateHookDidNotClobberInjectedState(before, after); err == nil {
+		t.Fatal("expected an error when injected mount/env/hook are swapped for unrelated ones")
+	}
+}
+
+func TestValidateHookDidNotClobberInjectedStateAllowsAdditions(t *testing.T) {
+	before := &specs.Spec{
+		Mounts: []specs.Mount{{Destination: "/dev/injected"}},
+		Process: &specs.Process{
+			Env: []string{"CDI_VAR=1"},
+		},
+		Hooks: &specs.Hooks{
+			Prestart: []specs.Hook{{Path: "/sbin/cdi-prestart"}},
+		},
+	}
+
+	after := &specs.Spec{
+		Mounts: []specs.Mount{
+			{Destination: "/dev/injected"},
+			{Destination: "/extra"},
+		},
+		Process: &specs.Process{
+			Env: []string{"CDI_VAR=1", "EXTRA=1"},
+		},
+		Hooks: &specs.Hooks{
+			Prestart: []specs.Hook{{Path: "/sbin/cdi-prestart"}, {Path: "/sbin/extra"}},
+		},
+	}
+
+	if err := validateHookDidNotClobberInjectedState(before, after); err != nil {
+		t.Fatalf("expected a filter that only adds mounts/env/hooks to pass, got: %v", err)
+	}
+}
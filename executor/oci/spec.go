@@ -0,0 +1,44 @@
+package oci
+
+import (
+	"github.com/containerd/containerd/v2/pkg/oci"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver/llbsolver/cdidevices"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/sys/user"
+)
+
+// SpecOpts carries the platform-independent knobs the executor uses to
+// assemble an OCI runtime spec for a single step. GenerateSpec is
+// implemented per-platform (spec_linux.go, spec_windows.go); each
+// implementation honors whatever subset of these fields makes sense for its
+// OS and silently ignores the rest, so the same *pb.Op can be solved against
+// workers on either platform.
+type SpecOpts struct {
+	ID         string
+	ResolvConf string
+	HostsFile  string
+	// Session is the caller's session group, used to resolve each
+	// executor.Mount's cache.Mountable to an actual mount.
+	Session         session.Group
+	SecurityMode    pb.SecurityMode
+	ApparmorProfile string
+	SELinux         bool
+	// HostDevices opts an INSECURE-mode container into the host's /dev
+	// device nodes (GPUs, /dev/fuse, /dev/kvm, loopback, tun, …) without
+	// requiring CDI. It is only honored together with
+	// pb.SecurityMode_INSECURE and is gated by the caller on the
+	// entitlements.EntitlementSecurityInsecure grant, the same as the
+	// rest of insecure mode.
+	HostDevices     bool
+	ProcessMode     ProcessMode
+	IdentityMapping *user.IdentityMapping
+	Ulimits         []*pb.Ulimit
+	CDIManager      *cdidevices.Manager
+	CDIDevices      []*pb.CDIDevice
+	// HookDir points at a directory of HookDescriptor JSON files
+	// evaluated against the assembled spec; empty disables the hook
+	// subsystem entirely.
+	HookDir   string
+	ExtraOpts []oci.SpecOpts
+}
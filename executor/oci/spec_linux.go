@@ -1,12 +1,16 @@
+//go:build linux
+
 package oci
 
 import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 
 	"github.com/containerd/containerd/v2/core/containers"
 	"github.com/containerd/containerd/v2/core/mount"
@@ -14,6 +18,8 @@ import (
 	"github.com/containerd/containerd/v2/pkg/oci"
 	cdseccomp "github.com/containerd/containerd/v2/pkg/seccomp"
 	"github.com/containerd/continuity/fs"
+	"github.com/moby/buildkit/executor"
+	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/snapshot"
 	"github.com/moby/buildkit/solver/llbsolver/cdidevices"
 	"github.com/moby/buildkit/solver/pb"
@@ -37,6 +43,138 @@ const (
 	tracingSocketPath = "/dev/otel-grpc.sock"
 )
 
+// GenerateSpec generates an OCI runtime spec for running meta/mounts under
+// runc. It assembles the spec options in the same order the Linux executor
+// has always applied them (LLB mounts, then the resolv.conf/hosts/cgroup
+// mounts, then security, then process-mode, then id-mapping, rlimits and CDI
+// devices) and hands them to containerd/oci's generator. The returned
+// cleanup is always non-nil and must be deferred by the caller even when
+// err != nil: once mounts have been materialized, a later failure must still
+// unmount them.
+func GenerateSpec(ctx context.Context, meta executor.Meta, mounts []executor.Mount, opt *SpecOpts) (*specs.Spec, func(), error) {
+	c := &containers.Container{ID: opt.ID}
+
+	llbMountOpts, release, err := withLLBMounts(ctx, mounts, opt.Session)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	var specOpts []oci.SpecOpts
+	specOpts = append(specOpts, withProcessArgs(meta.Args...))
+	specOpts = append(specOpts, llbMountOpts...)
+	specOpts = append(specOpts, generateMountOpts(opt.ResolvConf, opt.HostsFile)...)
+
+	securityOpts, err := generateSecurityOpts(opt.SecurityMode, opt.ApparmorProfile, opt.SELinux)
+	if err != nil {
+		return nil, release, err
+	}
+	specOpts = append(specOpts, securityOpts...)
+
+	processModeOpts, err := generateProcessModeOpts(opt.ProcessMode)
+	if err != nil {
+		return nil, release, err
+	}
+	specOpts = append(specOpts, processModeOpts...)
+
+	idmapOpts, err := generateIDmapOpts(opt.IdentityMapping)
+	if err != nil {
+		return nil, release, err
+	}
+	specOpts = append(specOpts, idmapOpts...)
+
+	rlimitOpts, err := generateRlimitOpts(opt.Ulimits)
+	if err != nil {
+		return nil, release, err
+	}
+	specOpts = append(specOpts, rlimitOpts...)
+
+	cdiOpts, err := generateCDIOpts(opt.CDIManager, opt.CDIDevices)
+	if err != nil {
+		return nil, release, err
+	}
+	specOpts = append(specOpts, cdiOpts...)
+
+	if opt.SecurityMode == pb.SecurityMode_INSECURE && opt.HostDevices {
+		hostDeviceOpts, err := withHostDevices()
+		if err != nil {
+			return nil, release, err
+		}
+		specOpts = append(specOpts, hostDeviceOpts...)
+	}
+
+	specOpts = append(specOpts, opt.ExtraOpts...)
+
+	s, err := oci.GenerateSpec(ctx, nil, c, specOpts...)
+	if err != nil {
+		return nil, release, err
+	}
+
+	hm, err := loadHookManager(opt.HookDir)
+	if err != nil {
+		return nil, release, err
+	}
+	if err := hm.Apply(ctx, s, s.Annotations); err != nil {
+		return nil, release, err
+	}
+
+	return s, release, nil
+}
+
+// withLLBMounts materializes every LLB-declared mount (bind/cache/secret/ssh/
+// tmpfs, anything an exec step asked for via executor.Mount) onto disk and
+// returns a bind-mount SpecOpt for each, plus the accumulated cleanup that
+// unmounts them all. Mounts are processed in order so later entries can
+// shadow earlier ones the same way repeated bind mounts at the same
+// destination already do in the runtime spec.
+func withLLBMounts(ctx context.Context, mounts []executor.Mount, g session.Group) (_ []oci.SpecOpts, release func(), _ error) {
+	var (
+		opts     []oci.SpecOpts
+		unmounts []func()
+	)
+	release = func() {
+		for i := len(unmounts) - 1; i >= 0; i-- {
+			unmounts[i]()
+		}
+	}
+
+	for _, m := range mounts {
+		if m.Src == nil {
+			continue
+		}
+		mountable, err := m.Src.Mount(ctx, m.Readonly, g)
+		if err != nil {
+			release()
+			return nil, func() {}, errors.Wrapf(err, "failed to mount %s", m.Dest)
+		}
+		lm := snapshot.LocalMounter(mountable)
+		dir, err := lm.Mount()
+		if err != nil {
+			release()
+			return nil, func() {}, errors.Wrapf(err, "failed to mount %s", m.Dest)
+		}
+		unmounts = append(unmounts, func() { lm.Unmount() })
+		opts = append(opts, withLLBMount(dir, m))
+	}
+
+	return opts, release, nil
+}
+
+func withLLBMount(src string, m executor.Mount) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *specs.Spec) error {
+		mountOpts := []string{"rbind"}
+		if m.Readonly {
+			mountOpts = append(mountOpts, "ro")
+		}
+		s.Mounts = append(s.Mounts, specs.Mount{
+			Destination: m.Dest,
+			Type:        "bind",
+			Source:      src,
+			Options:     mountOpts,
+		})
+		return nil
+	}
+}
+
 func withProcessArgs(args ...string) oci.SpecOpts {
 	return oci.WithProcessArgs(args...)
 }
@@ -188,6 +326,103 @@ func withDefaultProfile() oci.SpecOpts {
 	}
 }
 
+// withHostDevices exposes every device node under the host's /dev into the
+// container's spec. It is the INSECURE-mode analogue of `docker run
+// --privileged -v /dev:/dev`: steps that need a GPU, /dev/fuse, /dev/kvm, a
+// loopback device, or tun/tap without going through CDI can opt into it
+// explicitly.
+//
+// Unlike bind-mounted paths, device ownership is not remapped through the
+// container's IdentityMapping: dd.UID/dd.GID already come from os.Lstat on
+// the real host /dev tree, i.e. they are host-space ids, and runc chowns the
+// device node using those host ids before the container joins its user
+// namespace. Feeding an already-host id through idmap.ToHost (which maps a
+// container-namespace id to its host id) would double-translate ownership
+// under any non-identity mapping, so the host ids are passed through as-is.
+func withHostDevices() ([]oci.SpecOpts, error) {
+	hostDevices, err := getDevices("/dev")
+	if err != nil {
+		return nil, errors.Wrap(err, "enumerating host devices")
+	}
+	return []oci.SpecOpts{withDeviceList(hostDevices)}, nil
+}
+
+// withDeviceList injects devices into the spec verbatim, split out of
+// withHostDevices so the no-remapping behavior can be exercised without
+// walking the real host /dev tree.
+func withDeviceList(devices []specs.LinuxDevice) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Linux == nil {
+			s.Linux = &specs.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &specs.LinuxResources{}
+		}
+		for _, dd := range devices {
+			s.Linux.Devices = append(s.Linux.Devices, dd)
+			major, minor := dd.Major, dd.Minor
+			s.Linux.Resources.Devices = append(s.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+				Allow:  true,
+				Type:   dd.Type,
+				Major:  &major,
+				Minor:  &minor,
+				Access: "rwm",
+			})
+		}
+		return nil
+	}
+}
+
+// getDevices walks root and converts every character/block device it finds
+// into an OCI LinuxDevice, honoring the node's major/minor, mode and
+// ownership. Non-device files are skipped.
+func getDevices(root string) ([]specs.LinuxDevice, error) {
+	var out []specs.LinuxDevice
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// /dev commonly contains sockets and entries that vanish
+			// mid-walk (e.g. under udev); skip rather than fail the
+			// whole enumeration.
+			return nil
+		}
+		dev := deviceFromPath(path, fi)
+		if dev != nil {
+			out = append(out, *dev)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func deviceFromPath(path string, fi os.FileInfo) *specs.LinuxDevice {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	var devType string
+	switch {
+	case fi.Mode()&os.ModeCharDevice != 0:
+		devType = "c"
+	case fi.Mode()&os.ModeDevice != 0:
+		devType = "b"
+	default:
+		return nil
+	}
+
+	mode := fi.Mode() & os.ModePerm
+	uid, gid := stat.Uid, stat.Gid
+	return &specs.LinuxDevice{
+		Path:     path,
+		Type:     devType,
+		Major:    int64(unix.Major(uint64(stat.Rdev))),
+		Minor:    int64(unix.Minor(uint64(stat.Rdev))),
+		FileMode: &mode,
+		UID:      &uid,
+		GID:      &gid,
+	}
+}
+
 func withROBind(src, dest string) oci.SpecOpts {
 	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *specs.Spec) error {
 		s.Mounts = append(s.Mounts, specs.Mount{
@@ -0,0 +1,38 @@
+//go:build linux
+
+package oci
+
+import (
+	"context"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// TestWithDeviceListDoesNotRemapOwnership proves withDeviceList passes a
+// device node's UID/GID straight through: they come from an os.Lstat of the
+// real host /dev tree, i.e. are already host-space ids, so remapping them
+// through an IdentityMapping's ToHost (container id -> host id) would
+// double-translate ownership under any non-identity mapping.
+func TestWithDeviceListDoesNotRemapOwnership(t *testing.T) {
+	uid, gid := uint32(1000), uint32(2000)
+	devices := []specs.LinuxDevice{
+		{Path: "/dev/test0", Type: "c", Major: 1, Minor: 3, UID: &uid, GID: &gid},
+	}
+
+	s := &specs.Spec{}
+	if err := withDeviceList(devices)(context.Background(), nil, nil, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(s.Linux.Devices) != 1 {
+		t.Fatalf("expected 1 device in spec, got %d", len(s.Linux.Devices))
+	}
+	got := s.Linux.Devices[0]
+	if got.UID == nil || *got.UID != uid {
+		t.Fatalf("expected device UID %d unchanged, got %v", uid, got.UID)
+	}
+	if got.GID == nil || *got.GID != gid {
+		t.Fatalf("expected device GID %d unchanged, got %v", gid, got.GID)
+	}
+}
@@ -0,0 +1,126 @@
+//go:build windows
+
+package oci
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/v2/core/containers"
+	"github.com/containerd/containerd/v2/pkg/oci"
+	"github.com/moby/buildkit/executor"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver/pb"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// GenerateSpec generates an OCI runtime spec for running meta/mounts under a
+// Windows container runtime. It mirrors the shape of the Linux generator but
+// drops every field that has no Windows equivalent: there is no s.Linux to
+// populate, so AppArmor/SELinux/seccomp, cgroup namespaces and id-mapping are
+// silently skipped rather than erroring, letting LLB built for a Linux worker
+// still solve the non-RUN parts of a build against a Windows one.
+//
+// pb.SecurityMode_INSECURE is mapped onto Windows HostProcess containers,
+// which is the closest Windows equivalent of a privileged Linux container.
+//
+// The returned cleanup is always non-nil and must be deferred by the caller
+// even when err != nil: once mounts have been materialized, a later failure
+// must still unmount them.
+func GenerateSpec(ctx context.Context, meta executor.Meta, mounts []executor.Mount, opt *SpecOpts) (*specs.Spec, func(), error) {
+	c := &containers.Container{ID: opt.ID}
+
+	mountOpts, release, err := withWindowsMounts(ctx, mounts, opt.Session)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	var specOpts []oci.SpecOpts
+	specOpts = append(specOpts, oci.WithProcessArgs(meta.Args...))
+	specOpts = append(specOpts, mountOpts...)
+
+	if opt.SecurityMode == pb.SecurityMode_INSECURE {
+		specOpts = append(specOpts, withHostProcess())
+	}
+
+	specOpts = append(specOpts, opt.ExtraOpts...)
+
+	s, err := oci.GenerateSpec(ctx, nil, c, specOpts...)
+	if err != nil {
+		return nil, release, err
+	}
+
+	return s, release, nil
+}
+
+// withWindowsMounts resolves each executor.Mount's cache.Mountable to an
+// actual host path (the Windows equivalent of the Linux executor's
+// ref.ImmutableRef.Mount + LocalMounter pair) and translates it into a
+// Windows bind mount. Windows containers have no concept of bind-mount
+// options like "nosuid"/"rbind", so those are dropped; read-only is
+// preserved via the "ro" option, the one Windows' hcsshim mount driver
+// understands. It returns the accumulated cleanup that unmounts them all.
+func withWindowsMounts(ctx context.Context, mounts []executor.Mount, g session.Group) (_ []oci.SpecOpts, release func(), _ error) {
+	var (
+		opts     []oci.SpecOpts
+		unmounts []func()
+	)
+	release = func() {
+		for i := len(unmounts) - 1; i >= 0; i-- {
+			unmounts[i]()
+		}
+	}
+
+	for _, m := range mounts {
+		if m.Src == nil {
+			continue
+		}
+		mountable, err := m.Src.Mount(ctx, m.Readonly, g)
+		if err != nil {
+			release()
+			return nil, func() {}, errors.Wrapf(err, "failed to mount %s", m.Dest)
+		}
+		lm := snapshot.LocalMounter(mountable)
+		dir, err := lm.Mount()
+		if err != nil {
+			release()
+			return nil, func() {}, errors.Wrapf(err, "failed to mount %s", m.Dest)
+		}
+		unmounts = append(unmounts, func() { lm.Unmount() })
+
+		dest := m
+		opts = append(opts, func(_ context.Context, _ oci.Client, _ *containers.Container, s *specs.Spec) error {
+			mountOpts := []string{}
+			if dest.Readonly {
+				mountOpts = append(mountOpts, "ro")
+			}
+			s.Mounts = append(s.Mounts, specs.Mount{
+				Destination: dest.Dest,
+				Type:        "bind",
+				Source:      dir,
+				Options:     mountOpts,
+			})
+			return nil
+		})
+	}
+
+	return opts, release, nil
+}
+
+// withHostProcess maps pb.SecurityMode_INSECURE onto a Windows HostProcess
+// container, the closest analogue of a privileged Linux container: the
+// process runs directly against the host's filesystem and user namespace
+// rather than inside an isolated utility VM.
+func withHostProcess() oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *specs.Spec) error {
+		if s.Windows == nil {
+			return errors.New("spec has no Windows section to mark as HostProcess")
+		}
+		if s.Windows.HostProcess {
+			return nil
+		}
+		s.Windows.HostProcess = true
+		return nil
+	}
+}
@@ -3,10 +3,8 @@ package ops
 import (
 	"context"
 	"encoding/json"
-	"os"
+	"io/fs"
 
-	"github.com/containerd/continuity/fs"
-	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/frontend"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/snapshot"
@@ -25,6 +23,13 @@ type BuildOp struct {
 	op *pb.BuildOp
 	b  frontend.FrontendLLBBridge
 	v  solver.Vertex
+
+	// driverName and resolvedFrontend are populated by Exec and returned by
+	// BuilderProvenance: which driver produced the sub-build and, when that
+	// driver delegated to a frontend, which one. No provenance collection
+	// reads them; IsProvenanceProvider is only a marker method.
+	driverName       string
+	resolvedFrontend string
 }
 
 var _ solver.Op = &BuildOp{}
@@ -41,12 +46,19 @@ func NewBuildOp(v solver.Vertex, op *pb.Op_Build, b frontend.FrontendLLBBridge,
 }
 
 func (b *BuildOp) CacheMap(ctx context.Context, g session.Group, index int) (*solver.CacheMap, bool, error) {
+	driverName, _, err := resolveBuilderDriver(b.op)
+	if err != nil {
+		return nil, false, err
+	}
+
 	dt, err := json.Marshal(struct {
-		Type string
-		Exec *pb.BuildOp
+		Type   string
+		Driver string
+		Exec   *pb.BuildOp
 	}{
-		Type: buildCacheType,
-		Exec: b.op,
+		Type:   buildCacheType,
+		Driver: driverName,
+		Exec:   b.op,
 	})
 	if err != nil {
 		return nil, false, err
@@ -56,19 +68,28 @@ func (b *BuildOp) CacheMap(ctx context.Context, g session.Group, index int) (*so
 	if err != nil {
 		return nil, false, err
 	}
+
+	deps := make([]struct {
+		Selector          digest.Digest
+		ComputeDigestFunc solver.ResultBasedCacheFunc
+		PreprocessFunc    solver.PreprocessFunc
+	}, len(b.v.Inputs()))
+	if llbDef, ok := b.op.Inputs[pb.LLBDefinitionInput]; ok {
+		if i := int(llbDef.Input); i < len(deps) {
+			deps[i].ComputeDigestFunc = contentReaderCacheFunc
+		}
+	}
+
 	return &solver.CacheMap{
 		Digest: dgst,
-		Deps: make([]struct {
-			Selector          digest.Digest
-			ComputeDigestFunc solver.ResultBasedCacheFunc
-			PreprocessFunc    solver.PreprocessFunc
-		}, len(b.v.Inputs())),
+		Deps:   deps,
 	}, true, nil
 }
 
 func (b *BuildOp) Exec(ctx context.Context, g session.Group, inputs []solver.Result) (outputs []solver.Result, retErr error) {
-	if b.op.Builder != int64(pb.LLBBuilder) {
-		return nil, errors.Errorf("only LLB builder is currently allowed")
+	driverName, driver, err := resolveBuilderDriver(b.op)
+	if err != nil {
+		return nil, err
 	}
 
 	builderInputs := b.op.Inputs
@@ -88,51 +109,48 @@ func (b *BuildOp) Exec(ctx context.Context, g session.Group, inputs []solver.Res
 		return nil, errors.Errorf("invalid reference for build %T", inp.Sys())
 	}
 
-	mount, err := ref.ImmutableRef.Mount(ctx, true, g)
-	if err != nil {
-		return nil, err
-	}
-
-	lm := snapshot.LocalMounter(mount)
+	var (
+		root    fs.FS
+		unmount func()
+	)
+	if cr, ok := ref.ImmutableRef.(ContentReader); ok {
+		root = contentReaderFS{ctx: ctx, cr: cr, sizeCap: ContentReaderSizeCap}
+		unmount = func() {}
+	} else {
+		mount, err := ref.ImmutableRef.Mount(ctx, true, g)
+		if err != nil {
+			return nil, err
+		}
 
-	root, err := lm.Mount()
-	if err != nil {
-		return nil, err
-	}
+		lm := snapshot.LocalMounter(mount)
 
-	defer func() {
-		if retErr != nil && lm != nil {
+		dir, err := lm.Mount()
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if retErr != nil && lm != nil {
+				lm.Unmount()
+			}
+		}()
+
+		root = rootFS{dir: dir}
+		unmount = func() {
 			lm.Unmount()
+			lm = nil
 		}
-	}()
-
-	fn := pb.LLBDefaultDefinitionFile
-	if override, ok := b.op.Attrs[pb.AttrLLBDefinitionFilename]; ok {
-		fn = override
-	}
-
-	newfn, err := fs.RootPath(root, fn)
-	if err != nil {
-		return nil, errors.Wrapf(err, "working dir %s points to invalid target", fn)
 	}
 
-	f, err := os.Open(newfn)
+	req, err := driver.Parse(root, b.op.Attrs)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to open %s", newfn)
+		return nil, errors.Wrapf(err, "builder %q failed to parse input", driverName)
 	}
+	unmount()
 
-	def, err := llb.ReadFrom(f)
-	if err != nil {
-		f.Close()
-		return nil, err
-	}
-	f.Close()
-	lm.Unmount()
-	lm = nil
+	b.driverName = driverName
+	b.resolvedFrontend = req.Frontend
 
-	newRes, err := b.b.Solve(ctx, frontend.SolveRequest{
-		Definition: def.ToPB(),
-	}, g.SessionIterator().NextSession())
+	newRes, err := b.b.Solve(ctx, *req, g.SessionIterator().NextSession())
 	if err != nil {
 		return nil, err
 	}
@@ -158,3 +176,10 @@ func (b *BuildOp) Acquire(ctx context.Context) (solver.ReleaseFunc, error) {
 }
 
 func (b *BuildOp) IsProvenanceProvider() {}
+
+// BuilderProvenance returns the driver and, when that driver delegated to a
+// frontend, the resolved frontend name that produced this BuildOp's output.
+// Populated once Exec has run; empty beforehand.
+func (b *BuildOp) BuilderProvenance() (driver, resolvedFrontend string) {
+	return b.driverName, b.resolvedFrontend
+}
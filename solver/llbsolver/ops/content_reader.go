@@ -0,0 +1,119 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/worker"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// ContentReaderSizeCap bounds how many bytes contentReaderFS will read into
+// memory per file on the Exec fast path. A BuildOp input is expected to be a
+// handful of KB (an LLB definition or a Dockerfile); the cap exists so a
+// malicious or malformed definition input can't be used to exhaust worker
+// memory.
+var ContentReaderSizeCap int64 = 16 << 20 // 16 MiB
+
+// ContentReader lets BuildOp.Exec read a single small file out of an input
+// ref without mounting it: image-sourced refs can serve it straight out of
+// the content/blob store, local refs can implement it via a direct
+// snapshotter Walk/Open. Refs that don't implement it fall back to the
+// existing Mount + LocalMounter path.
+type ContentReader interface {
+	OpenFile(ctx context.Context, path string) (io.ReadCloser, error)
+	// ContentDigest returns the digest of the bytes OpenFile would read,
+	// incorporated into BuildOp's CacheMap so the cache key reflects the
+	// bytes actually read rather than just the ref's identity.
+	ContentDigest(ctx context.Context) (digest.Digest, error)
+}
+
+// contentReaderFS adapts a ContentReader to an io/fs.FS so BuilderDrivers
+// can stay oblivious to whether their input came from a mount or the
+// content store. Every Open reads the whole file into memory up front
+// (capped at sizeCap) so Stat can report an accurate size, the same
+// trade-off BuilderDrivers already accept for mounted files of this size.
+type contentReaderFS struct {
+	ctx     context.Context
+	cr      ContentReader
+	sizeCap int64
+}
+
+func (c contentReaderFS) Open(name string) (fs.File, error) {
+	// name comes straight from a BuilderDriver (for llbBuilderDriver, from
+	// the attacker-reachable pb.AttrLLBDefinitionFilename attr) and there is
+	// no mounted directory here to jail it to the way rootFS.Open jails to
+	// its dir via continuityfs.RootPath. fs.ValidPath is the containment
+	// io/fs.FS implementations are already required to enforce on Open: it
+	// rejects absolute paths and any ".." element, so a crafted filename
+	// can't reach outside whatever root the ContentReader itself scopes
+	// OpenFile to.
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	rc, err := c.cr.OpenFile(c.ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, c.sizeCap+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", name)
+	}
+	if int64(len(data)) > c.sizeCap {
+		return nil, errors.Errorf("%s exceeds size cap of %d bytes", name, c.sizeCap)
+	}
+
+	return &memFile{name: name, r: bytes.NewReader(data), size: int64(len(data))}, nil
+}
+
+type memFile struct {
+	name string
+	r    *bytes.Reader
+	size int64
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return memFileInfo{name: f.name, size: f.size}, nil }
+func (f *memFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *memFile) Close() error               { return nil }
+
+type memFileInfo struct {
+	name string
+	size int64
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return false }
+func (i memFileInfo) Sys() any           { return nil }
+
+// contentReaderCacheFunc is installed as the ComputeDigestFunc for the build
+// definition input so that, when the input ref supports the ContentReader
+// fast path, its CacheMap folds in the digest of the bytes that would
+// actually be read rather than relying solely on the ref's own identity.
+func contentReaderCacheFunc(ctx context.Context, res solver.Result, _ session.Group) (digest.Digest, error) {
+	cr, ok := contentReaderFor(res)
+	if !ok {
+		return "", nil
+	}
+	return cr.ContentDigest(ctx)
+}
+
+func contentReaderFor(res solver.Result) (ContentReader, bool) {
+	ref, ok := res.Sys().(*worker.WorkerRef)
+	if !ok {
+		return nil, false
+	}
+	cr, ok := ref.ImmutableRef.(ContentReader)
+	return cr, ok
+}
@@ -0,0 +1,64 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+type stubContentReader struct {
+	data map[string][]byte
+}
+
+func (s stubContentReader) OpenFile(_ context.Context, path string) (io.ReadCloser, error) {
+	d, ok := s.data[path]
+	if !ok {
+		return nil, errNotFound(path)
+	}
+	return io.NopCloser(bytes.NewReader(d)), nil
+}
+
+func (s stubContentReader) ContentDigest(context.Context) (digest.Digest, error) {
+	return "", nil
+}
+
+type errNotFound string
+
+func (e errNotFound) Error() string { return "not found: " + string(e) }
+
+func TestContentReaderFSOpenRejectsPathTraversal(t *testing.T) {
+	cr := contentReaderFS{
+		ctx:     context.Background(),
+		cr:      stubContentReader{data: map[string][]byte{"definition.llb": []byte("x")}},
+		sizeCap: ContentReaderSizeCap,
+	}
+
+	for _, name := range []string{"../definition.llb", "../../etc/passwd", "/etc/passwd", "a/../../b"} {
+		if _, err := cr.Open(name); err == nil {
+			t.Fatalf("expected Open(%q) to be rejected as a path escaping the ref root", name)
+		}
+	}
+}
+
+func TestContentReaderFSOpenReadsCleanPath(t *testing.T) {
+	cr := contentReaderFS{
+		ctx:     context.Background(),
+		cr:      stubContentReader{data: map[string][]byte{"definition.llb": []byte("hello")}},
+		sizeCap: ContentReaderSizeCap,
+	}
+
+	f, err := cr.Open("definition.llb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expected %q, got %q", "hello", data)
+	}
+}